@@ -0,0 +1,175 @@
+// Package config loads odm's YAML configuration file and renders the
+// folder/file templates used to lay out downloaded titles on disk.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OverwritePolicy controls what odm does when a destination file already
+// exists.
+type OverwritePolicy string
+
+const (
+	OverwriteSkip      OverwritePolicy = "skip"
+	OverwriteOverwrite OverwritePolicy = "overwrite"
+	OverwriteFail      OverwritePolicy = "fail"
+)
+
+// ContentTypeConfig overrides the default templates for a specific ODM
+// ContentType, such as "Audiobook" or "Music".
+type ContentTypeConfig struct {
+	FolderTemplate string `yaml:"folder_template"`
+	FileTemplate   string `yaml:"file_template"`
+}
+
+// Config is the root of ~/.config/odm/config.yaml.
+type Config struct {
+	OutputDir       string                       `yaml:"output_dir"`
+	FolderTemplate  string                       `yaml:"folder_template"`
+	FileTemplate    string                       `yaml:"file_template"`
+	CoverSize       int                          `yaml:"cover_size"`
+	WriteM3U        bool                         `yaml:"write_m3u"`
+	WriteCue        bool                         `yaml:"write_cue"`
+	OverwritePolicy OverwritePolicy              `yaml:"overwrite_policy"`
+	ContentTypes    map[string]ContentTypeConfig `yaml:"content_types"`
+}
+
+// Default returns the configuration odm uses when no config file is
+// present, matching its historical flag-driven behavior.
+func Default() *Config {
+	return &Config{
+		OutputDir:       ".",
+		FolderTemplate:  "{{.Title}}",
+		FileTemplate:    "{{.Title}} - {{.PartName}}",
+		CoverSize:       0,
+		WriteM3U:        true,
+		WriteCue:        false,
+		OverwritePolicy: OverwriteSkip,
+		ContentTypes:    map[string]ContentTypeConfig{},
+	}
+}
+
+// DefaultPath returns ~/.config/odm/config.yaml.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "odm", "config.yaml"), nil
+}
+
+// Load reads and parses the config file at path, layering it over Default.
+// A missing file is not an error; Default is returned unchanged.
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config %q: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parsing config %q: %w", path, err)
+	}
+
+	switch config.OverwritePolicy {
+	case OverwriteSkip, OverwriteOverwrite, OverwriteFail:
+	default:
+		return nil, fmt.Errorf("invalid overwrite_policy %q", config.OverwritePolicy)
+	}
+
+	return config, nil
+}
+
+// TemplatesFor returns the folder/file templates to use for the given ODM
+// ContentType, falling back to the top-level templates when no
+// content-type-specific override is configured.
+func (c *Config) TemplatesFor(contentType string) (folder, file string) {
+	if override, ok := c.ContentTypes[contentType]; ok {
+		folder, file = override.FolderTemplate, override.FileTemplate
+	}
+	if folder == "" {
+		folder = c.FolderTemplate
+	}
+	if file == "" {
+		file = c.FileTemplate
+	}
+	return folder, file
+}
+
+// TemplateData holds the variables available to folder_template and
+// file_template.
+type TemplateData struct {
+	Title      string
+	SortTitle  string
+	Publisher  string
+	Creators   map[string]string
+	PartNumber uint
+	PartName   string
+}
+
+// forbiddenFilenameChars matches characters that are illegal or awkward in
+// a single file or folder name component, across Windows, macOS and
+// Linux. The forward slash is not included here: RenderPath splits on it,
+// and Render replaces it separately.
+var forbiddenFilenameChars = regexp.MustCompile(`[<>:"\\|?*\x00-\x1f]`)
+
+// Render executes tmplText against data and sanitizes the result so it is
+// safe to use as a single path component, such as file_template.
+func Render(tmplText string, data TemplateData) (string, error) {
+	rendered, err := execute(tmplText, data)
+	if err != nil {
+		return "", err
+	}
+	return sanitizeComponent(strings.ReplaceAll(rendered, "/", "_")), nil
+}
+
+// RenderPath executes tmplText against data and sanitizes the result as a
+// filesystem path: the rendered text is split on path separators first,
+// so a folder_template such as
+// "{{index .Creators "Author"}}/{{.Title}}" produces nested directories
+// instead of being flattened into one sanitized name, then each component
+// is sanitized independently and rejoined with filepath.Join.
+func RenderPath(tmplText string, data TemplateData) (string, error) {
+	rendered, err := execute(tmplText, data)
+	if err != nil {
+		return "", err
+	}
+
+	components := strings.FieldsFunc(rendered, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+	for i, component := range components {
+		components[i] = sanitizeComponent(component)
+	}
+	return filepath.Join(components...), nil
+}
+
+func sanitizeComponent(s string) string {
+	return forbiddenFilenameChars.ReplaceAllString(s, "_")
+}
+
+func execute(tmplText string, data TemplateData) (string, error) {
+	tmpl, err := template.New("").Parse(tmplText)
+	if err != nil {
+		return "", fmt.Errorf("parsing template %q: %w", tmplText, err)
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing template %q: %w", tmplText, err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		data TemplateData
+		want string
+	}{
+		{
+			name: "plain title",
+			tmpl: "{{.Title}}",
+			data: TemplateData{Title: "My Book"},
+			want: "My Book",
+		},
+		{
+			name: "part number and name",
+			tmpl: "{{.Title}} - {{.PartName}}",
+			data: TemplateData{Title: "My Book", PartName: "Part 1"},
+			want: "My Book - Part 1",
+		},
+		{
+			name: "forbidden characters are sanitized",
+			tmpl: "{{.Title}}",
+			data: TemplateData{Title: `Who: What? <Really>*"|\`},
+			want: "Who_ What_ _Really_____",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.tmpl, tt.data)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderInvalidTemplate(t *testing.T) {
+	if _, err := Render("{{.Nope", TemplateData{}); err == nil {
+		t.Error("Render() with malformed template: got nil error, want error")
+	}
+}
+
+func TestRenderPath(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		data TemplateData
+		want string
+	}{
+		{
+			name: "no separators behaves like Render",
+			tmpl: "{{.Title}}",
+			data: TemplateData{Title: "My Book"},
+			want: "My Book",
+		},
+		{
+			name: "creates nested directories",
+			tmpl: "{{index .Creators \"Author\"}}/{{.Title}}",
+			data: TemplateData{Title: "My Book", Creators: map[string]string{"Author": "Jane Doe"}},
+			want: "Jane Doe/My Book",
+		},
+		{
+			name: "sanitizes each component independently",
+			tmpl: "{{index .Creators \"Author\"}}/{{.Title}}",
+			data: TemplateData{Title: `My: Book`, Creators: map[string]string{"Author": "Jane/Doe"}},
+			want: "Jane/Doe/My_ Book",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderPath(tt.tmpl, tt.data)
+			if err != nil {
+				t.Fatalf("RenderPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatesFor(t *testing.T) {
+	cfg := &Config{
+		FolderTemplate: "{{.Title}}",
+		FileTemplate:   "{{.Title}} - {{.PartName}}",
+		ContentTypes: map[string]ContentTypeConfig{
+			"Music": {FolderTemplate: "Music/{{.Title}}"},
+		},
+	}
+
+	folder, file := cfg.TemplatesFor("Music")
+	if folder != "Music/{{.Title}}" {
+		t.Errorf("folder = %q, want override", folder)
+	}
+	if file != cfg.FileTemplate {
+		t.Errorf("file = %q, want fallback to top-level FileTemplate", file)
+	}
+
+	folder, file = cfg.TemplatesFor("Audiobook")
+	if folder != cfg.FolderTemplate || file != cfg.FileTemplate {
+		t.Errorf("TemplatesFor(unknown content type) = (%q, %q), want top-level templates", folder, file)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/arnavdugar/odm/postprocess"
+	"github.com/arnavdugar/odm/storage"
+)
+
+// writeCueSheet writes a CUE sheet for parts to "<title>.cue" in outDir.
+// Since odm keeps each part as its own file rather than concatenating
+// them, the sheet has one single-track FILE entry per part instead of one
+// FILE with multiple TRACKs.
+func writeCueSheet(store storage.Storage, outDir, title string, creators []Creator, parts []postprocess.Part) error {
+	var performer string
+	for _, creator := range creators {
+		if creator.Role == "Author" {
+			performer = creator.Name
+			break
+		}
+	}
+
+	var buf strings.Builder
+	if performer != "" {
+		fmt.Fprintf(&buf, "PERFORMER %q\n", performer)
+	}
+	fmt.Fprintf(&buf, "TITLE %q\n", title)
+
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "FILE %q MP3\n", path.Base(part.Path))
+		fmt.Fprintf(&buf, "  TRACK %02d AUDIO\n", part.Number)
+		fmt.Fprintf(&buf, "    TITLE %q\n", part.Name)
+		if performer != "" {
+			fmt.Fprintf(&buf, "    PERFORMER %q\n", performer)
+		}
+		fmt.Fprintln(&buf, "    INDEX 01 00:00:00")
+	}
+
+	cueFile, err := store.Create(path.Join(outDir, fmt.Sprintf("%s.cue", title)))
+	if err != nil {
+		return err
+	}
+	defer cueFile.Close()
+
+	_, err = io.WriteString(cueFile, buf.String())
+	return err
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/go-retryablehttp"
+
+	"github.com/arnavdugar/odm/storage"
+)
+
+var chunkSize = flag.Int64("chunk-size", 4*1024*1024, "size in bytes of each parallel download chunk")
+var concurrency = flag.Int("concurrency", 4, "number of chunks to download in parallel")
+var checksumManifest = flag.String("checksum", "", "path to a JSON manifest of filename -> expected SHA-256 checksums")
+
+// partSidecar records which chunks of a part have already been written to
+// disk, so an interrupted download can resume without refetching completed
+// chunks. It lives alongside the destination file as "<file>.part".
+type partSidecar struct {
+	Url       string `json:"url"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunkSize"`
+	Completed []bool `json:"completed"`
+}
+
+func sidecarPath(filePath string) string {
+	return filePath + ".part"
+}
+
+func loadSidecar(store storage.Storage, filePath, url string, size, chunkSize int64) *partSidecar {
+	reader, err := store.Open(sidecarPath(filePath))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil
+	}
+	var sidecar partSidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		return nil
+	}
+	if sidecar.Url != url || sidecar.Size != size || sidecar.ChunkSize != chunkSize {
+		// Stale sidecar from a different file or a different chunking scheme.
+		return nil
+	}
+	return &sidecar
+}
+
+func (s *partSidecar) save(store storage.Storage, filePath string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	writer, err := store.Create(sidecarPath(filePath))
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	_, err = writer.Write(data)
+	return err
+}
+
+// downloadFile fetches url into filePath through store, authenticating
+// with the given OverDrive license. When the server advertises byte-range
+// support and store allows random-access writes, the file is split into
+// fixed-size chunks and downloaded concurrently through a bounded worker
+// pool, resuming from a ".part" sidecar on retry. Otherwise it falls back
+// to a single sequential GET, streamed straight to store.
+func downloadFile(url string, license string, store storage.Storage, filePath string) error {
+	size, rangesSupported, err := probeRange(url, license)
+	if err != nil {
+		log.Errorw("error probing range support", "url", url, "err", err)
+		return err
+	}
+
+	if rangesSupported && size > 0 {
+		err = downloadFileChunked(url, license, store, filePath, size)
+		if errors.Is(err, storage.ErrRandomAccessUnsupported) {
+			log.Infow("storage backend does not support random access, downloading sequentially", "url", url)
+			err = downloadFileSequential(url, license, store, filePath)
+		}
+	} else {
+		log.Infow("server does not support byte ranges, downloading sequentially", "url", url)
+		err = downloadFileSequential(url, license, store, filePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	return verifyChecksum(store, filePath)
+}
+
+// probeRange issues a HEAD request to learn the size of url and whether the
+// server supports ranged requests via "Accept-Ranges: bytes".
+func probeRange(url string, license string) (size int64, rangesSupported bool, err error) {
+	request, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	request.Header.Set("ClientId", ClientId)
+	request.Header.Set("License", license)
+	request.Header.Set("User-Agent", UserAgent)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0, false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return 0, false, nil
+	}
+
+	return response.ContentLength, response.Header.Get("Accept-Ranges") == "bytes", nil
+}
+
+func downloadFileSequential(url string, license string, store storage.Storage, filePath string) error {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("ClientId", ClientId)
+	request.Header.Set("License", license)
+	request.Header.Set("User-Agent", UserAgent)
+
+	retryClient := retryablehttp.NewClient()
+	httpClient := retryClient.StandardClient()
+	response, err := httpClient.Do(request)
+	if err != nil {
+		log.Errorw("error doing http request", "request", request, "err", err)
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf(
+			"downloading file returned a %d status", response.StatusCode)
+	}
+
+	file, err := store.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, response.Body)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// downloadFileChunked downloads size bytes of url into filePath in
+// *chunkSize-sized chunks, using up to *concurrency workers through the
+// retryablehttp client. Progress is tracked in a ".part" sidecar so that a
+// subsequent call for the same url/filePath only fetches missing chunks.
+// It returns storage.ErrRandomAccessUnsupported unchanged if store can't
+// back random-access writes, so the caller can fall back.
+func downloadFileChunked(url string, license string, store storage.Storage, filePath string, size int64) error {
+	file, err := store.OpenFile(filePath, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+
+	sidecar := loadSidecar(store, filePath, url, size, *chunkSize)
+	numChunks := int((size + *chunkSize - 1) / *chunkSize)
+	if sidecar == nil {
+		sidecar = &partSidecar{
+			Url:       url,
+			Size:      size,
+			ChunkSize: *chunkSize,
+			Completed: make([]bool, numChunks),
+		}
+	}
+
+	retryClient := retryablehttp.NewClient()
+	retryClient.Logger = nil
+	httpClient := retryClient.StandardClient()
+
+	var (
+		mu      sync.Mutex
+		saveErr error
+	)
+	markComplete := func(chunk int) {
+		mu.Lock()
+		defer mu.Unlock()
+		sidecar.Completed[chunk] = true
+		if err := sidecar.save(store, filePath); err != nil {
+			saveErr = err
+		}
+	}
+
+	// stop is closed the moment any worker reports an error, so the
+	// producer below abandons any chunks it hasn't sent yet instead of
+	// blocking forever on a pending channel nobody is draining anymore.
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	pending := make(chan int)
+	go func() {
+		defer close(pending)
+		for chunk := 0; chunk < numChunks; chunk++ {
+			if sidecar.Completed[chunk] {
+				continue
+			}
+			select {
+			case pending <- chunk:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, *concurrency)
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range pending {
+				start := int64(chunk) * *chunkSize
+				end := start + *chunkSize - 1
+				if end >= size {
+					end = size - 1
+				}
+				if err := downloadChunk(httpClient, url, license, file, start, end); err != nil {
+					errs <- fmt.Errorf("chunk %d: %w", chunk, err)
+					stopOnce.Do(func() { close(stop) })
+					return
+				}
+				markComplete(chunk)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+
+	store.Remove(sidecarPath(filePath))
+	return nil
+}
+
+func downloadChunk(httpClient *http.Client, url string, license string, file storage.RandomAccessFile, start, end int64) error {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("ClientId", ClientId)
+	request.Header.Set("License", license)
+	request.Header.Set("User-Agent", UserAgent)
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusPartialContent && response.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading chunk returned a %d status", response.StatusCode)
+	}
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, start)
+	return err
+}
+
+// verifyChecksum computes a SHA-256 of the assembled file and, if
+// *checksumManifest was given, compares it against the expected value for
+// this file's base name, failing loudly on mismatch.
+func verifyChecksum(store storage.Storage, filePath string) error {
+	sum, err := sha256File(store, filePath)
+	if err != nil {
+		return err
+	}
+	log.Debugw("computed checksum", "file", filePath, "sha256", sum)
+
+	if *checksumManifest == "" {
+		return nil
+	}
+
+	expected, err := loadChecksumManifest(*checksumManifest)
+	if err != nil {
+		return err
+	}
+
+	want, ok := expected[filepath.Base(filePath)]
+	if !ok {
+		return nil
+	}
+	if want != sum {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", filePath, want, sum)
+	}
+	return nil
+}
+
+func sha256File(store storage.Storage, filePath string) (string, error) {
+	file, err := store.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func loadChecksumManifest(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := make(map[string]string)
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
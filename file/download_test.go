@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/arnavdugar/odm/storage"
+)
+
+func TestMain(m *testing.M) {
+	log = zap.NewNop().Sugar()
+	os.Exit(m.Run())
+}
+
+func TestSidecarRoundTrip(t *testing.T) {
+	store := storage.NewMemory()
+	sidecar := &partSidecar{
+		Url:       "http://example/part.mp3",
+		Size:      100,
+		ChunkSize: 10,
+		Completed: []bool{true, false, true},
+	}
+	if err := sidecar.save(store, "part.mp3"); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	got := loadSidecar(store, "part.mp3", sidecar.Url, sidecar.Size, sidecar.ChunkSize)
+	if got == nil {
+		t.Fatal("loadSidecar() = nil, want saved sidecar")
+	}
+	if got.Url != sidecar.Url || got.Size != sidecar.Size || got.ChunkSize != sidecar.ChunkSize {
+		t.Errorf("loadSidecar() = %+v, want %+v", got, sidecar)
+	}
+	if len(got.Completed) != len(sidecar.Completed) {
+		t.Fatalf("Completed length = %d, want %d", len(got.Completed), len(sidecar.Completed))
+	}
+	for i := range sidecar.Completed {
+		if got.Completed[i] != sidecar.Completed[i] {
+			t.Errorf("Completed[%d] = %v, want %v", i, got.Completed[i], sidecar.Completed[i])
+		}
+	}
+}
+
+func TestLoadSidecarMissing(t *testing.T) {
+	store := storage.NewMemory()
+	if got := loadSidecar(store, "part.mp3", "http://example/part.mp3", 100, 10); got != nil {
+		t.Errorf("loadSidecar() = %+v, want nil for a missing sidecar", got)
+	}
+}
+
+func TestLoadSidecarStale(t *testing.T) {
+	store := storage.NewMemory()
+	sidecar := &partSidecar{Url: "http://example/part.mp3", Size: 100, ChunkSize: 10, Completed: make([]bool, 10)}
+	if err := sidecar.save(store, "part.mp3"); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		url       string
+		size      int64
+		chunkSize int64
+	}{
+		{"different url", "http://example/other.mp3", 100, 10},
+		{"different size", sidecar.Url, 200, 10},
+		{"different chunk size", sidecar.Url, 100, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadSidecar(store, "part.mp3", tt.url, tt.size, tt.chunkSize); got != nil {
+				t.Errorf("loadSidecar() = %+v, want nil for a stale sidecar", got)
+			}
+		})
+	}
+}
+
+// rangeServer serves content from a byte slice, honoring HEAD probes and
+// ranged GETs the way downloadFile expects an OverDrive CDN endpoint to.
+func rangeServer(t *testing.T, content []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		rangeHeader := r.Header.Get("Range")
+		if rangeHeader == "" {
+			w.WriteHeader(http.StatusOK)
+			w.Write(content)
+			return
+		}
+
+		var start, end int64
+		if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if end >= int64(len(content)) {
+			end = int64(len(content)) - 1
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start : end+1])
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadFileChunked(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10)) // 100 bytes
+
+	origChunkSize, origConcurrency := *chunkSize, *concurrency
+	*chunkSize, *concurrency = 16, 3
+	t.Cleanup(func() { *chunkSize, *concurrency = origChunkSize, origConcurrency })
+
+	server := rangeServer(t, content)
+	store := storage.NewMemory()
+
+	if err := downloadFile(server.URL, "license", store, "part.mp3"); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+
+	reader, err := store.Open("part.mp3")
+	if err != nil {
+		t.Fatalf("store.Open() error = %v", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading downloaded file: %v", err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("downloaded content = %q, want %q", got, content)
+	}
+
+	if exists, _ := store.Exists(sidecarPath("part.mp3")); exists {
+		t.Error("sidecar still exists after a complete download, want it removed")
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	content := []byte("hello world")
+	store := storage.NewMemory()
+	writer, err := store.Create("part.mp3")
+	if err != nil {
+		t.Fatalf("store.Create() error = %v", err)
+	}
+	if _, err := writer.Write(content); err != nil {
+		t.Fatalf("writer.Write() error = %v", err)
+	}
+	writer.Close()
+
+	sum, err := sha256File(store, "part.mp3")
+	if err != nil {
+		t.Fatalf("sha256File() error = %v", err)
+	}
+
+	origManifest := *checksumManifest
+	t.Cleanup(func() { *checksumManifest = origManifest })
+
+	t.Run("matching checksum", func(t *testing.T) {
+		manifestPath := filepath.Join(t.TempDir(), "checksums.json")
+		os.WriteFile(manifestPath, []byte(fmt.Sprintf(`{"part.mp3": %q}`, sum)), 0666)
+		*checksumManifest = manifestPath
+
+		if err := verifyChecksum(store, "part.mp3"); err != nil {
+			t.Errorf("verifyChecksum() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("mismatched checksum", func(t *testing.T) {
+		manifestPath := filepath.Join(t.TempDir(), "checksums.json")
+		os.WriteFile(manifestPath, []byte(`{"part.mp3": "deadbeef"}`), 0666)
+		*checksumManifest = manifestPath
+
+		if err := verifyChecksum(store, "part.mp3"); err == nil {
+			t.Error("verifyChecksum() error = nil, want a mismatch error")
+		}
+	})
+
+	t.Run("no manifest configured", func(t *testing.T) {
+		*checksumManifest = ""
+		if err := verifyChecksum(store, "part.mp3"); err != nil {
+			t.Errorf("verifyChecksum() error = %v, want nil", err)
+		}
+	})
+}
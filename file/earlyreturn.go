@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"unicode/utf16"
+)
+
+// signAcquisition computes the OverDrive client signing hash shared by the
+// license acquisition and early-return requests.
+func signAcquisition(clientId string, omc string, osVersion string) (hash string) {
+	licenseValue := fmt.Sprintf("%s|%s|%s|%s", clientId, omc, osVersion, HashSecret)
+	encodedLicenseValue := utf16.Encode([]rune(licenseValue))
+
+	sum := sha1.New()
+	binary.Write(sum, binary.LittleEndian, encodedLicenseValue)
+
+	return base64.StdEncoding.EncodeToString(sum.Sum(nil))
+}
+
+// earlyReturnLicense returns the loan identified by contentId via
+// earlyReturnUrl, releasing the hold before it would otherwise expire.
+func earlyReturnLicense(earlyReturnUrl *url.URL, contentId string) error {
+	earlyReturnUrl.RawQuery = url.Values{
+		"MediaID":  []string{contentId},
+		"ClientID": []string{ClientId},
+		"OMC":      []string{OMC},
+		"OS":       []string{OS},
+		"Hash":     []string{signAcquisition(ClientId, OMC, OS)},
+	}.Encode()
+
+	request, err := http.NewRequest("GET", earlyReturnUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("User-Agent", UserAgent)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("early return returned a %d status: %s", response.StatusCode, body)
+	}
+
+	log.Infow("returned license early", "ContentId", contentId)
+	return nil
+}
+
+// returnLicense parses the .odm at filename and returns its loan early,
+// without downloading anything.
+func returnLicense(filename string) error {
+	if filename == "" {
+		return errors.New("odm file required")
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data := OverDriveMedia{}
+	if err := xml.NewDecoder(file).Decode(&data); err != nil {
+		return fmt.Errorf("failed to decode: %w", err)
+	}
+
+	if data.EarlyReturnUrl.Value == nil {
+		return errors.New("odm has no EarlyReturnUrl")
+	}
+
+	return earlyReturnLicense(data.EarlyReturnUrl.Value, data.ContentId)
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"crypto/sha1"
-	"encoding/base64"
-	"encoding/binary"
+	"context"
 	"encoding/xml"
 	"errors"
 	"flag"
@@ -15,16 +13,30 @@ import (
 	"path"
 	"strconv"
 	"strings"
-	"unicode/utf16"
 
-	"github.com/hashicorp/go-retryablehttp"
 	"go.uber.org/zap"
+
+	"github.com/arnavdugar/odm/config"
+	"github.com/arnavdugar/odm/postprocess"
+	"github.com/arnavdugar/odm/storage"
 )
 
-var filename = ""        // flag.String("f", "", ".odm file")
-var outputDirectory = "" // flag.String("o", ".", "output directory")
 var makeOutputDir = flag.Bool("m", false, "Make a unique output directory")
 var dryRun = flag.Bool("d", false, "Dry run, don't download anything")
+var configPath = flag.String("config", "", "path to config file (default ~/.config/odm/config.yaml)")
+var folderTemplateFlag = flag.String("folder-template", "", "override the config's folder_template")
+var fileTemplateFlag = flag.String("file-template", "", "override the config's file_template")
+var overwritePolicyFlag = flag.String("overwrite-policy", "", "override the config's overwrite_policy (skip, overwrite, fail)")
+var remote = flag.String("remote", "", "stream output to an rclone remote (e.g. s3:bucket/path) instead of local disk")
+var transcodeFormat = flag.String("transcode", "", "transcode downloaded parts to mp3, m4b, flac, or opus")
+var bitrate = flag.String("bitrate", "", "audio bitrate to pass to ffmpeg when transcoding, e.g. 128k")
+var writeTags = flag.Bool("tags", false, "write ID3v2/MP4 tags parsed from the ODM metadata")
+var writeReplayGain = flag.Bool("replaygain", false, "compute and write ReplayGain track/album tags")
+var merge = flag.Bool("merge", false, "merge all parts into a single chaptered m4b (requires -transcode m4b)")
+var serve = flag.String("serve", "", "run as a daemon, serving a job queue HTTP API on the given address (e.g. :8080)")
+var inbox = flag.String("inbox", "", "directory to watch for new .odm files when running with -serve")
+var earlyReturn = flag.Bool("return", false, "return the loan for the given .odm early instead of downloading it")
+var returnAfterDownload = flag.Bool("return-after-download", false, "return the loan early immediately after a successful download")
 var log *zap.SugaredLogger
 
 const ClientId = "00000000-0000-0000-0000-000000000000"
@@ -35,6 +47,7 @@ const UserAgent = "OverDrive Media Console"
 
 type OverDriveMedia struct {
 	AcquisitionUrl Url      `xml:"License>AcquisitionUrl"`
+	EarlyReturnUrl Url      `xml:"License>EarlyReturnUrl"`
 	ContentId      string   `xml:"id,attr"`
 	Formats        []Format `xml:"Formats>Format"`
 	Metadata       string   `xml:",cdata"`
@@ -137,29 +150,39 @@ func main() {
 	log = logger.Sugar()
 
 	flag.Parse()
-	outputDirectory = flag.Arg(0)
-	filename = flag.Arg(1)
-	// log.Fatalw("done", "m", makeOutputDir)
 
-	err := run()
+	if *serve != "" {
+		if err := serveQueue(*serve, *inbox); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *earlyReturn {
+		if err := returnLicense(flag.Arg(0)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	outputDirectory := flag.Arg(0)
+	filename := flag.Arg(1)
+
+	err := run(outputDirectory, filename)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func run() error {
+// run downloads and processes a single .odm file at filename into
+// outputDirectory. It is the entry point for both one-shot CLI invocations
+// and jobs dispatched by the -serve queue.
+func run(outputDirectory string, filename string) error {
 	if filename == "" {
 		return errors.New("odm file required")
 	}
 
-	licenseValue := fmt.Sprintf("%s|%s|%s|%s", ClientId, OMC, OS, HashSecret)
-	encodedLicenseValue := utf16.Encode([]rune(licenseValue))
-
-	hash := sha1.New()
-	binary.Write(hash, binary.LittleEndian, encodedLicenseValue)
-
-	licenseHash := hash.Sum(nil)
-	encodedLicenseHash := base64.StdEncoding.EncodeToString(licenseHash)
+	encodedLicenseHash := signAcquisition(ClientId, OMC, OS)
 
 	file, err := os.Open(filename)
 	if err != nil {
@@ -188,6 +211,14 @@ func run() error {
 		return err
 	}
 
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if outputDirectory == "" {
+		outputDirectory = cfg.OutputDir
+	}
+
 	if len(data.Formats) != 1 {
 		return fmt.Errorf("expected 1 format, got %d", len(data.Formats))
 	}
@@ -210,7 +241,7 @@ func run() error {
 	if *dryRun {
 		log.Infow("data", "data", data)
 		log.Infow("metadata", "metadata", metadata)
-		os.Exit(0)
+		return nil
 	}
 
 	log.Infow("Downloading",
@@ -263,64 +294,101 @@ func run() error {
 		"name", data.Formats[0].Name,
 	)
 
+	folderTemplate, fileTemplate := cfg.TemplatesFor(metadata.ContentType)
+	templateData := newTemplateData(metadata)
+
+	store := newStorage()
+
 	var outDir string
 	if *makeOutputDir {
-		outDir = path.Join(outputDirectory, metadata.Title)
+		folderName, err := config.RenderPath(folderTemplate, templateData)
+		if err != nil {
+			return err
+		}
+		outDir = path.Join(outputDirectory, folderName)
 		log.Infow("creating output directory", "directory", outDir)
-		os.MkdirAll(outDir, 0777)
+		store.MkdirAll(outDir, 0777)
 	} else {
 		log.Infow("output directory", "directory", outDir)
 		outDir = outputDirectory
 	}
 
-	m3uFile, err := os.Create(path.Join(outDir, fmt.Sprintf("%s.m3u", metadata.Title)))
-	if err != nil {
-		log.Infow("error creating playlist",
-			"err", err,
-		)
-	} else {
-		defer m3uFile.Close()
+	var m3uFile io.WriteCloser
+	if cfg.WriteM3U {
+		var err error
+		m3uFile, err = store.Create(path.Join(outDir, fmt.Sprintf("%s.m3u", metadata.Title)))
+		if err != nil {
+			log.Infow("error creating playlist",
+				"err", err,
+			)
+			m3uFile = nil
+		} else {
+			defer m3uFile.Close()
+		}
+	}
+	writeM3U := func(format string, args ...any) {
+		if m3uFile == nil {
+			return
+		}
+		io.WriteString(m3uFile, fmt.Sprintf(format, args...))
 	}
 
-	m3uFile.WriteString("#EXTM3U\n#EXTENC:UTF-8\n")
-	m3uFile.WriteString(fmt.Sprintf("#EXTALB:%s\n", metadata.Title))
-	m3uFile.WriteString(fmt.Sprintf("#PLAYLIST:%s by %s\n", metadata.Title, metadata.Creators[0].Name))
+	writeM3U("#EXTM3U\n#EXTENC:UTF-8\n")
+	writeM3U("#EXTALB:%s\n", metadata.Title)
+	writeM3U("#PLAYLIST:%s by %s\n", metadata.Title, metadata.Creators[0].Name)
 
 	for _, creator := range metadata.Creators {
-		m3uFile.WriteString(fmt.Sprintf("#EXTART:%s (%s)\n", creator.Name, creator.Role))
+		writeM3U("#EXTART:%s (%s)\n", creator.Name, creator.Role)
 	}
 
+	var coverPath string
 	if metadata.CoverUrl != "" {
 		ext := path.Ext(metadata.CoverUrl)
-		coverPath := path.Join(outDir, fmt.Sprintf("cover%s", ext))
-		err := downloadFile(metadata.CoverUrl, string(license), coverPath)
+		candidatePath := path.Join(outDir, fmt.Sprintf("cover%s", ext))
+		err := downloadFile(metadata.CoverUrl, string(license), store, candidatePath)
 		if err != nil {
 			log.Infow("error downloading cover",
 				"err", err,
 			)
 		} else {
-			m3uFile.WriteString(fmt.Sprintf("#EXTIMG:cover\ncover%s\n", ext))
+			coverPath = candidatePath
+			writeM3U("#EXTIMG:cover\ncover%s\n", ext)
 		}
 	}
 
 	if metadata.ThumbnailUrl != "" {
 		ext := path.Ext(metadata.ThumbnailUrl)
 		thumbPath := path.Join(outDir, fmt.Sprintf("thumb%s", ext))
-		err := downloadFile(metadata.ThumbnailUrl, string(license), thumbPath)
+		err := downloadFile(metadata.ThumbnailUrl, string(license), store, thumbPath)
 		if err != nil {
 			log.Infow("error downloading thumb",
 				"err", err,
 			)
 		} else {
-			m3uFile.WriteString(fmt.Sprintf("#EXTIMG:thumbnail\nthumb%s\n", ext))
+			writeM3U("#EXTIMG:thumbnail\nthumb%s\n", ext)
 		}
 	}
 
+	var postprocessParts []postprocess.Part
 	for _, part := range data.Formats[0].Parts.Part {
-		m3uFile.WriteString("\n")
-		fileName := fmt.Sprintf("%s - %s.mp3", metadata.Title, part.Name)
+		writeM3U("\n")
+
+		partData := templateData
+		partData.PartNumber = part.Number
+		partData.PartName = part.Name
+		baseName, err := config.Render(fileTemplate, partData)
+		if err != nil {
+			return err
+		}
+		fileName := baseName + ".mp3"
 		filePath := path.Join(outDir, fileName)
 
+		if skip, err := handleExisting(store, filePath, cfg.OverwritePolicy); err != nil {
+			return err
+		} else if skip {
+			continue
+		}
+
 		log.Infow("downloading part...",
 			"name", part.Name,
 			"number", part.Number,
@@ -328,7 +396,7 @@ func run() error {
 		)
 
 		partUrl := fmt.Sprintf("%s/%s", data.Formats[0].Protocols[0].BaseUrl, part.Filename)
-		err := downloadFile(partUrl, string(license), filePath)
+		err = downloadFile(partUrl, string(license), store, filePath)
 		if err != nil {
 			log.Infow("error downloading",
 				"err", err,
@@ -340,48 +408,151 @@ func run() error {
 			log.Errorw("unable to interpret duration", "duration", part.Duration, "part", part.Name, "err", err)
 			duration = 0
 		}
-		m3uFile.WriteString(fmt.Sprintf("#EXTINF:%d,%s - %s\n", duration, metadata.Title, part.Name))
-		m3uFile.WriteString(fmt.Sprintf("%s\n", fileName))
+		writeM3U("#EXTINF:%d,%s - %s\n", duration, metadata.Title, part.Name)
+		writeM3U("%s\n", fileName)
+
+		postprocessParts = append(postprocessParts, postprocess.Part{
+			Path:     filePath,
+			Name:     part.Name,
+			Number:   part.Number,
+			Duration: duration,
+		})
+	}
+
+	finalParts, err := runPostprocess(postprocessParts, metadata, coverPath)
+	if err != nil {
+		log.Errorw("postprocessing failed", "err", err)
+		return err
+	}
+
+	if cfg.WriteCue {
+		if err := writeCueSheet(store, outDir, metadata.Title, metadata.Creators, finalParts); err != nil {
+			log.Infow("error writing cue sheet", "err", err)
+		}
+	}
+
+	if *returnAfterDownload {
+		if data.EarlyReturnUrl.Value == nil {
+			log.Errorw("-return-after-download set but odm has no EarlyReturnUrl")
+		} else if err := earlyReturnLicense(data.EarlyReturnUrl.Value, data.ContentId); err != nil {
+			log.Errorw("early return failed", "err", err)
+			return err
+		}
 	}
 
 	return nil
 }
 
-func downloadFile(url string, license string, filePath string) error {
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
+// runPostprocess builds a postprocess.Processor from the -transcode,
+// -bitrate, -tags, -replaygain and -merge flags and runs it over parts, if
+// any of those flags were set. coverPath is the already-downloaded cover
+// art file to embed, if any. It returns the final parts on disk, which
+// callers needing up-to-date paths (e.g. the cue sheet) should use instead
+// of the parts they passed in, since -merge replaces them with one file.
+func runPostprocess(parts []postprocess.Part, metadata Metadata, coverPath string) ([]postprocess.Part, error) {
+	if *transcodeFormat == "" && !*writeTags && !*writeReplayGain && !*merge {
+		return parts, nil
 	}
 
-	request.Header.Set("ClientId", ClientId)
-	request.Header.Set("License", license)
-	request.Header.Set("User-Agent", UserAgent)
+	var creators []postprocess.Creator
+	for _, creator := range metadata.Creators {
+		creators = append(creators, postprocess.Creator{Role: creator.Role, Name: creator.Name})
+	}
+
+	processor := postprocess.New(postprocess.Options{
+		Format:     *transcodeFormat,
+		Bitrate:    *bitrate,
+		Tags:       *writeTags,
+		ReplayGain: *writeReplayGain,
+		Merge:      *merge,
+		Logger:     log,
+	})
+
+	return processor.Process(context.Background(), parts, postprocess.Metadata{
+		Title:       metadata.Title,
+		SortTitle:   metadata.SortTitle,
+		Publisher:   metadata.Publisher,
+		Description: metadata.Description,
+		CoverPath:   coverPath,
+		Creators:    creators,
+	})
+}
 
-	retryClient := retryablehttp.NewClient()
-	httpClient := retryClient.StandardClient()
-	response, err := httpClient.Do(request)
+// loadConfig reads the YAML config file (-config, or the default
+// ~/.config/odm/config.yaml) and applies any CLI template/policy overrides.
+func loadConfig() (*config.Config, error) {
+	configFile := *configPath
+	if configFile == "" {
+		var err error
+		configFile, err = config.DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg, err := config.Load(configFile)
 	if err != nil {
-		log.Errorw("error doing http request", "request", request, "err", err)
-		return err
+		return nil, err
 	}
 
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf(
-			"downloading file returned a %d status", response.StatusCode)
+	if *folderTemplateFlag != "" {
+		cfg.FolderTemplate = *folderTemplateFlag
+	}
+	if *fileTemplateFlag != "" {
+		cfg.FileTemplate = *fileTemplateFlag
+	}
+	if *overwritePolicyFlag != "" {
+		cfg.OverwritePolicy = config.OverwritePolicy(*overwritePolicyFlag)
 	}
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
+	return cfg, nil
+}
+
+// newTemplateData builds the folder/file template variables shared by
+// every part of a title; callers fill in PartNumber/PartName per part.
+func newTemplateData(metadata Metadata) config.TemplateData {
+	creators := make(map[string]string)
+	for _, creator := range metadata.Creators {
+		if _, exists := creators[creator.Role]; !exists {
+			creators[creator.Role] = creator.Name
+		}
 	}
-	defer file.Close()
 
-	_, err = io.Copy(file, response.Body)
-	if err != nil {
-		return err
+	return config.TemplateData{
+		Title:     metadata.Title,
+		SortTitle: metadata.SortTitle,
+		Publisher: metadata.Publisher,
+		Creators:  creators,
 	}
+}
 
-	return nil
+// handleExisting applies policy to a file that may already exist at
+// filePath, returning skip=true when the caller should move on without
+// downloading.
+func handleExisting(store storage.Storage, filePath string, policy config.OverwritePolicy) (skip bool, err error) {
+	if policy == config.OverwriteOverwrite {
+		return false, nil
+	}
+	exists, err := store.Exists(filePath)
+	if err != nil || !exists {
+		return false, nil
+	}
+	switch policy {
+	case config.OverwriteFail:
+		return false, fmt.Errorf("%s already exists", filePath)
+	default:
+		log.Infow("skipping existing file", "file", filePath)
+		return true, nil
+	}
+}
+
+// newStorage returns the Storage backend to write output to, per -remote.
+func newStorage() storage.Storage {
+	if *remote != "" {
+		log.Infow("streaming output to remote", "remote", *remote)
+		return storage.NewRclone(*remote)
+	}
+	return storage.NewLocal()
 }
 
 func durationToSecs(duration string) (int, error) {
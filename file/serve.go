@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/arnavdugar/odm/queue"
+)
+
+const serveWorkers = 4
+
+// serveQueue turns odm into a daemon: it watches inboxDir (if set) for new
+// .odm files and enqueues them, and exposes an HTTP+JSON job API on addr.
+// It runs until interrupted.
+func serveQueue(addr string, inboxDir string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	q := queue.New(serveWorkers, runJob)
+	go q.Start(ctx)
+
+	if inboxDir != "" {
+		if err := watchInbox(ctx, inboxDir, q); err != nil {
+			return err
+		}
+	}
+
+	server := &http.Server{Addr: addr, Handler: jobsHandler(q, cfg.OutputDir)}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Infow("serving job queue", "addr", addr, "inbox", inboxDir)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// runJob adapts run's one-shot CLI entry point to a queue.Handler. run
+// itself does not accept a context, so a job already in progress cannot be
+// interrupted: Cancel only has an effect if it lands before the check
+// below. A job still waiting in the queue is not cancelled either, since
+// Queue.Cancel reports false for a job that has not started.
+func runJob(ctx context.Context, job *queue.Job) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	job.SetStatus(queue.StatusLicensing)
+	job.Logf("acquiring license for %s", job.Path)
+
+	job.SetStatus(queue.StatusDownloading)
+	err := run(job.Dest, job.Path)
+	if err != nil {
+		job.Logf("error: %s", err)
+		return err
+	}
+
+	job.SetStatus(queue.StatusPostprocess)
+	job.Logf("done")
+	return nil
+}
+
+// watchInbox enqueues any .odm file already in inboxDir, then watches for
+// new ones until ctx is cancelled.
+func watchInbox(ctx context.Context, inboxDir string, q *queue.Queue) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(inboxDir); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	entries, err := os.ReadDir(inboxDir)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".odm") {
+			q.Enqueue(filepath.Join(inboxDir, entry.Name()))
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Create|fsnotify.Write) != 0 && strings.HasSuffix(event.Name, ".odm") {
+					log.Infow("new .odm in inbox", "file", event.Name)
+					q.Enqueue(event.Name)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorw("inbox watcher error", "err", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// jobsHandler builds the /jobs HTTP+JSON API: POST /jobs to upload an .odm
+// and enqueue it, GET /jobs and GET /jobs/{id} for status, DELETE
+// /jobs/{id} to cancel, and GET /jobs/{id}/log to stream log lines via SSE.
+// outputRoot confines the optional per-job "dest" form field uploaders can
+// send with POST /jobs.
+func jobsHandler(q *queue.Queue, outputRoot string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			handleUpload(w, r, q, outputRoot)
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, listJobInfo(q))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/jobs/")
+		if id, ok := strings.CutSuffix(rest, "/log"); ok {
+			handleJobLog(w, r, q, id)
+			return
+		}
+
+		job, ok := q.Get(rest)
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, job.Info())
+		case http.MethodDelete:
+			q.Cancel(rest)
+			writeJSON(w, http.StatusOK, job.Info())
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	return mux
+}
+
+func listJobInfo(q *queue.Queue) []queue.Info {
+	jobs := q.List()
+	infos := make([]queue.Info, len(jobs))
+	for i, job := range jobs {
+		infos[i] = job.Info()
+	}
+	return infos
+}
+
+// handleUpload accepts a multipart "file" upload, stages it in its own
+// temp subdirectory (so jobs can never collide on filename and nothing
+// else lands loose in the system temp dir), and enqueues it. An optional
+// "dest" form field sets the job's output directory to a subdirectory of
+// outputRoot, overriding the config default; output still goes to
+// -remote when the daemon was started with it. The staging directory is
+// removed once the job finishes, win or lose.
+func handleUpload(w http.ResponseWriter, r *http.Request, q *queue.Queue, outputRoot string) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading upload: %s", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	dest := outputRoot
+	if rawDest := r.FormValue("dest"); rawDest != "" {
+		dest, err = sanitizeDest(outputRoot, rawDest)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid dest: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	stagingDir, err := os.MkdirTemp("", "odm-job-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stagingPath := filepath.Join(stagingDir, filepath.Base(header.Filename))
+	staged, err := os.Create(stagingPath)
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer staged.Close()
+
+	if _, err := io.Copy(staged, file); err != nil {
+		os.RemoveAll(stagingDir)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	job := q.EnqueueWithDest(stagingPath, dest, func() { os.RemoveAll(stagingDir) })
+	writeJSON(w, http.StatusCreated, job.Info())
+}
+
+// sanitizeDest confines a client-supplied "dest" to a subdirectory of
+// root: absolute paths are rejected outright, and the joined result is
+// required to stay under root, so neither an absolute path nor a "../"
+// escape can make the daemon write outside its configured output tree.
+func sanitizeDest(root, dest string) (string, error) {
+	if filepath.IsAbs(dest) {
+		return "", fmt.Errorf("dest must be a relative path")
+	}
+
+	joined, err := filepath.Abs(filepath.Join(root, dest))
+	if err != nil {
+		return "", err
+	}
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if joined != rootAbs && !strings.HasPrefix(joined, rootAbs+string(filepath.Separator)) {
+		return "", fmt.Errorf("dest escapes the configured output directory")
+	}
+	return joined, nil
+}
+
+func handleJobLog(w http.ResponseWriter, r *http.Request, q *queue.Queue, id string) {
+	job, ok := q.Get(id)
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lines, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", line)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
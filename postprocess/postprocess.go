@@ -0,0 +1,90 @@
+// Package postprocess turns the raw MP3 parts odm downloads into
+// library-ready audio: transcoding, tagging, ReplayGain analysis, and
+// optional merging into a single chaptered file.
+package postprocess
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Creator mirrors a single <Creator> entry from the ODM metadata, already
+// resolved to a display name for a given role (e.g. "Author", "Narrator").
+type Creator struct {
+	Role string
+	Name string
+}
+
+// Metadata carries the fields of a downloaded title that a Processor may
+// want to embed as tags or use to name output files.
+type Metadata struct {
+	Title       string
+	SortTitle   string
+	Publisher   string
+	Description string
+	// CoverPath is the path to the cover art already downloaded alongside
+	// the parts, or empty if there is none to embed.
+	CoverPath string
+	Creators  []Creator
+}
+
+// Part is one downloaded audio part, already on disk at Path.
+type Part struct {
+	Path     string
+	Name     string
+	Number   uint
+	Duration int // seconds
+}
+
+// Processor runs a post-processing step over the downloaded parts of a
+// title. Implementations may be chained by the caller to build a pipeline,
+// e.g. transcode, then tag, then compute ReplayGain. It returns the final
+// parts on disk, which may differ from the input (Merge replaces many
+// parts with a single merged file), so callers needing up-to-date paths
+// (e.g. a cue sheet) should use the returned parts rather than the ones
+// they passed in.
+type Processor interface {
+	Process(ctx context.Context, parts []Part, metadata Metadata) ([]Part, error)
+}
+
+// Options configures the ffmpeg-backed Processor returned by New.
+type Options struct {
+	// Format is the output container/codec: "mp3", "m4b", "flac", or "opus".
+	// Empty leaves the parts as downloaded.
+	Format string
+	// Bitrate is passed to ffmpeg's -b:a, e.g. "128k". Ignored for flac.
+	Bitrate string
+	// Tags writes ID3v2/MP4 tags from Metadata into each output file.
+	Tags bool
+	// ReplayGain computes and writes track/album ReplayGain tags.
+	ReplayGain bool
+	// Merge combines all parts into a single output file with chapter
+	// markers derived from each Part's Name and Duration. Requires Format
+	// "m4b"; Process returns an error for any other Format.
+	Merge bool
+	// Logger receives progress and error messages. Defaults to a no-op
+	// logger when nil.
+	Logger *zap.SugaredLogger
+}
+
+// New returns a Processor that shells out to ffmpeg to implement opts.
+func New(opts Options) Processor {
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop().Sugar()
+	}
+	return &ffmpegProcessor{opts: opts}
+}
+
+func (o Options) validate() error {
+	switch o.Format {
+	case "", "mp3", "m4b", "flac", "opus":
+	default:
+		return fmt.Errorf("unsupported transcode format: %q", o.Format)
+	}
+	if o.Merge && o.Format != "m4b" {
+		return fmt.Errorf("-merge requires -transcode m4b, got %q", o.Format)
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type ffmpegProcessor struct {
+	opts Options
+}
+
+var replayGainLine = regexp.MustCompile(`track_gain = ([-+]?[0-9.]+) dB`)
+var replayGainPeak = regexp.MustCompile(`track_peak = ([0-9.]+)`)
+
+func (p *ffmpegProcessor) Process(ctx context.Context, parts []Part, metadata Metadata) ([]Part, error) {
+	if err := p.opts.validate(); err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return parts, nil
+	}
+
+	if p.opts.Merge {
+		merged, err := p.mergeAndTag(ctx, parts, metadata)
+		if err != nil {
+			return nil, err
+		}
+		return []Part{merged}, nil
+	}
+
+	var album *albumGain
+	if p.opts.ReplayGain {
+		gain, peak, err := scanAlbumReplayGain(ctx, parts)
+		if err != nil {
+			return nil, fmt.Errorf("scanning album replaygain: %w", err)
+		}
+		album = &albumGain{gain: gain, peak: peak}
+	}
+
+	for i := range parts {
+		if err := p.transcodeAndTag(ctx, &parts[i], metadata, album); err != nil {
+			return nil, fmt.Errorf("processing part %q: %w", parts[i].Name, err)
+		}
+	}
+	return parts, nil
+}
+
+// transcodeAndTag remuxes/transcodes a single part in place (replacing its
+// extension to match the target format), then applies tags and ReplayGain.
+// album, if non-nil, is the title's shared album-level ReplayGain, scanned
+// once across all parts by Process.
+func (p *ffmpegProcessor) transcodeAndTag(ctx context.Context, part *Part, metadata Metadata, album *albumGain) error {
+	dest := part.Path
+	if p.opts.Format != "" {
+		dest = replaceExt(part.Path, p.opts.Format)
+	}
+
+	// ffmpeg truncates its output file before it's done reading its input,
+	// so transcoding straight to dest would corrupt part.Path whenever it
+	// equals dest (e.g. -transcode mp3 on an already-.mp3 part, the usual
+	// case). Write to a temp file instead and rename over dest once ffmpeg
+	// exits, the same way applyReplayGain already does.
+	tmpDest := dest + ".tmp" + filepath.Ext(dest)
+	args := p.transcodeArgs(part, metadata, tmpDest)
+
+	p.opts.Logger.Infow("transcoding part", "part", part.Name, "dest", dest)
+	if err := runFfmpeg(ctx, args...); err != nil {
+		os.Remove(tmpDest)
+		return err
+	}
+	if dest != part.Path {
+		os.Remove(part.Path)
+	}
+	if err := os.Rename(tmpDest, dest); err != nil {
+		return err
+	}
+	part.Path = dest
+
+	if p.opts.ReplayGain {
+		if err := p.applyReplayGain(ctx, part, album); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transcodeArgs builds the ffmpeg args to remux/transcode part to tmpDest,
+// including any tagging and cover-art args. part.Path is ffmpeg's only
+// input, so a cover, if any, is mapped as input 1.
+func (p *ffmpegProcessor) transcodeArgs(part *Part, metadata Metadata, tmpDest string) []string {
+	args := []string{"-y", "-i", part.Path}
+	args = append(args, p.taggingArgs(metadata, part, 1)...)
+	if p.opts.Bitrate != "" && p.opts.Format != "flac" {
+		args = append(args, "-b:a", p.opts.Bitrate)
+	}
+	return append(args, tmpDest)
+}
+
+// mergeAndTag combines all parts into a single chaptered M4B and returns
+// the merged Part, with Duration set to the sum of the input parts'.
+func (p *ffmpegProcessor) mergeAndTag(ctx context.Context, parts []Part, metadata Metadata) (Part, error) {
+	outDir := filepath.Dir(parts[0].Path)
+	dest := filepath.Join(outDir, sanitizeFilename(metadata.Title)+".m4b")
+
+	concatList, err := writeConcatList(outDir, parts)
+	if err != nil {
+		return Part{}, err
+	}
+	defer os.Remove(concatList)
+
+	chapters, err := writeChaptersFile(outDir, parts)
+	if err != nil {
+		return Part{}, err
+	}
+	defer os.Remove(chapters)
+
+	args := p.mergeArgs(metadata, concatList, chapters, dest)
+
+	var duration int
+	for _, part := range parts {
+		duration += part.Duration
+	}
+	merged := Part{Path: dest, Name: metadata.Title, Number: 1, Duration: duration}
+
+	p.opts.Logger.Infow("merging parts", "title", metadata.Title, "dest", dest, "parts", len(parts))
+	if err := runFfmpeg(ctx, args...); err != nil {
+		return Part{}, err
+	}
+
+	if p.opts.ReplayGain {
+		gain, peak, err := scanReplayGain(ctx, dest)
+		if err != nil {
+			return Part{}, fmt.Errorf("scanning replaygain: %w", err)
+		}
+		if err := p.applyReplayGain(ctx, &merged, &albumGain{gain: gain, peak: peak}); err != nil {
+			return Part{}, err
+		}
+	}
+	return merged, nil
+}
+
+// mergeArgs builds the ffmpeg args to concatenate concatList with chapters
+// into dest, including any tagging and cover-art args. concatList and
+// chapters are already inputs 0 and 1, so a cover, if any, is mapped as
+// input 2.
+func (p *ffmpegProcessor) mergeArgs(metadata Metadata, concatList, chapters, dest string) []string {
+	args := []string{
+		"-y",
+		"-f", "concat", "-safe", "0", "-i", concatList,
+		"-i", chapters, "-map_metadata", "1",
+	}
+	args = append(args, p.taggingArgs(metadata, nil, 2)...)
+	if p.opts.Bitrate != "" {
+		args = append(args, "-b:a", p.opts.Bitrate)
+	}
+	return append(args, "-c:a", "aac", dest)
+}
+
+// taggingArgs builds ffmpeg -metadata flags from Metadata, plus cover art
+// input/mapping when CoverPath has already been downloaded alongside part.
+// baseInputs is the number of ffmpeg inputs the caller has already added
+// (e.g. 1 for a single source file, 2 for mergeAndTag's concat+chapters
+// inputs); the cover, if any, is prepended as a new input and mapped at
+// index baseInputs.
+func (p *ffmpegProcessor) taggingArgs(metadata Metadata, part *Part, baseInputs int) []string {
+	if !p.opts.Tags {
+		return nil
+	}
+
+	var args []string
+	set := func(key, value string) {
+		if value != "" {
+			args = append(args, "-metadata", fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	set("title", metadata.Title)
+	set("album", metadata.Title)
+	set("publisher", metadata.Publisher)
+	set("comment", metadata.Description)
+	for _, creator := range metadata.Creators {
+		switch creator.Role {
+		case "Author":
+			set("artist", creator.Name)
+			set("composer", creator.Name)
+		case "Narrator":
+			set("performer", creator.Name)
+		}
+	}
+	if part != nil {
+		set("track", strconv.FormatUint(uint64(part.Number), 10))
+	}
+
+	if metadata.CoverPath != "" {
+		coverIndex := strconv.Itoa(baseInputs)
+		args = append([]string{"-i", metadata.CoverPath, "-map", "0", "-map", coverIndex, "-disposition:v", "attached_pic"}, args...)
+	}
+	return args
+}
+
+// albumGain is a shared REPLAYGAIN_ALBUM_GAIN/PEAK pair, scanned once
+// across every part of a title rather than per file.
+type albumGain struct {
+	gain float64
+	peak float64
+}
+
+// applyReplayGain runs ffmpeg's replaygain filter in analysis mode and
+// writes the resulting track (and, if album is non-nil, album) gain/peak
+// as REPLAYGAIN_* tags on the file in place.
+func (p *ffmpegProcessor) applyReplayGain(ctx context.Context, part *Part, album *albumGain) error {
+	gain, peak, err := scanReplayGain(ctx, part.Path)
+	if err != nil {
+		return fmt.Errorf("scanning replaygain for %q: %w", part.Name, err)
+	}
+
+	tagged := part.Path + ".rg" + filepath.Ext(part.Path)
+	args := []string{
+		"-y", "-i", part.Path,
+		"-metadata", fmt.Sprintf("REPLAYGAIN_TRACK_GAIN=%.2f dB", gain),
+		"-metadata", fmt.Sprintf("REPLAYGAIN_TRACK_PEAK=%.6f", peak),
+	}
+	if album != nil {
+		args = append(args,
+			"-metadata", fmt.Sprintf("REPLAYGAIN_ALBUM_GAIN=%.2f dB", album.gain),
+			"-metadata", fmt.Sprintf("REPLAYGAIN_ALBUM_PEAK=%.6f", album.peak))
+	}
+	args = append(args, "-c", "copy", tagged)
+
+	if err := runFfmpeg(ctx, args...); err != nil {
+		return err
+	}
+	os.Remove(part.Path)
+	return os.Rename(tagged, part.Path)
+}
+
+// scanReplayGain runs a single loudness scan via ffmpeg's replaygain
+// filter and parses the track gain/peak from its stderr output.
+func scanReplayGain(ctx context.Context, path string) (gain, peak float64, err error) {
+	return runReplayGainScan(ctx, "-i", path)
+}
+
+// scanAlbumReplayGain concatenates parts and runs the same loudness scan
+// over the result, so every part of a non-merged title can share one
+// album-level gain/peak instead of each getting its own.
+func scanAlbumReplayGain(ctx context.Context, parts []Part) (gain, peak float64, err error) {
+	concatList, err := writeConcatList(filepath.Dir(parts[0].Path), parts)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(concatList)
+
+	return runReplayGainScan(ctx, "-f", "concat", "-safe", "0", "-i", concatList)
+}
+
+func runReplayGainScan(ctx context.Context, inputArgs ...string) (gain, peak float64, err error) {
+	args := append(append([]string{}, inputArgs...), "-af", "replaygain", "-f", "null", "-")
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, 0, fmt.Errorf("%w: %s", err, stderr.String())
+	}
+
+	gainMatch := replayGainLine.FindStringSubmatch(stderr.String())
+	peakMatch := replayGainPeak.FindStringSubmatch(stderr.String())
+	if gainMatch == nil || peakMatch == nil {
+		return 0, 0, fmt.Errorf("could not parse replaygain output")
+	}
+	gain, err = strconv.ParseFloat(gainMatch[1], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	peak, err = strconv.ParseFloat(peakMatch[1], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return gain, peak, nil
+}
+
+func runFfmpeg(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg %s: %w: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return nil
+}
+
+func writeConcatList(dir string, parts []Part) (string, error) {
+	path := filepath.Join(dir, "concat.txt")
+	var buf bytes.Buffer
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "file '%s'\n", filepath.Base(part.Path))
+	}
+	return path, os.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// writeChaptersFile writes an ffmetadata chapters file with one chapter per
+// part, using each Part's Duration (seconds) to compute chapter offsets.
+func writeChaptersFile(dir string, parts []Part) (string, error) {
+	path := filepath.Join(dir, "chapters.txt")
+	var buf bytes.Buffer
+	buf.WriteString(";FFMETADATA1\n")
+
+	var offsetMs int64
+	for _, part := range parts {
+		durationMs := int64(part.Duration) * 1000
+		fmt.Fprintf(&buf, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			offsetMs, offsetMs+durationMs, part.Name)
+		offsetMs += durationMs
+	}
+	return path, os.WriteFile(path, buf.Bytes(), 0666)
+}
+
+func replaceExt(path, format string) string {
+	ext := "." + format
+	if format == "mp3" {
+		ext = ".mp3"
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+var forbiddenFilenameChars = regexp.MustCompile(`[<>:"/\\|?*]`)
+
+func sanitizeFilename(name string) string {
+	return forbiddenFilenameChars.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,111 @@
+package postprocess
+
+import (
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func newTestProcessor(opts Options) *ffmpegProcessor {
+	opts.Logger = zap.NewNop().Sugar()
+	return &ffmpegProcessor{opts: opts}
+}
+
+func TestTranscodeArgsSameExtension(t *testing.T) {
+	p := newTestProcessor(Options{Format: "mp3", Tags: true})
+	part := &Part{Path: "/out/part.mp3", Number: 1}
+	metadata := Metadata{Title: "My Book"}
+
+	got := p.transcodeArgs(part, metadata, "/out/part.mp3.tmp.mp3")
+
+	want := []string{
+		"-y", "-i", "/out/part.mp3",
+		"-metadata", "title=My Book",
+		"-metadata", "album=My Book",
+		"-metadata", "track=1",
+		"/out/part.mp3.tmp.mp3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transcodeArgs() = %q, want %q", got, want)
+	}
+	if got[len(got)-1] == part.Path {
+		t.Errorf("transcodeArgs() output %q must not be the same file as the input", got[len(got)-1])
+	}
+}
+
+func TestTranscodeArgsWithCover(t *testing.T) {
+	p := newTestProcessor(Options{Tags: true})
+	part := &Part{Path: "/out/part.mp3"}
+	metadata := Metadata{Title: "My Book", CoverPath: "/out/cover.jpg"}
+
+	got := p.transcodeArgs(part, metadata, "/out/part.mp3.tmp.mp3")
+
+	want := []string{
+		"-y", "-i", "/out/part.mp3",
+		"-i", "/out/cover.jpg", "-map", "0", "-map", "1", "-disposition:v", "attached_pic",
+		"-metadata", "title=My Book",
+		"-metadata", "album=My Book",
+		"-metadata", "track=0",
+		"/out/part.mp3.tmp.mp3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transcodeArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestMergeArgsWithCover(t *testing.T) {
+	p := newTestProcessor(Options{Format: "m4b", Merge: true, Tags: true})
+	metadata := Metadata{Title: "My Book", CoverPath: "/out/cover.jpg"}
+
+	got := p.mergeArgs(metadata, "/out/concat.txt", "/out/chapters.txt", "/out/My Book.m4b")
+
+	want := []string{
+		"-y",
+		"-f", "concat", "-safe", "0", "-i", "/out/concat.txt",
+		"-i", "/out/chapters.txt", "-map_metadata", "1",
+		"-i", "/out/cover.jpg", "-map", "0", "-map", "2", "-disposition:v", "attached_pic",
+		"-metadata", "title=My Book",
+		"-metadata", "album=My Book",
+		"-c:a", "aac", "/out/My Book.m4b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestMergeArgsNoCover(t *testing.T) {
+	p := newTestProcessor(Options{Format: "m4b", Merge: true, Tags: true})
+	metadata := Metadata{Title: "My Book"}
+
+	got := p.mergeArgs(metadata, "/out/concat.txt", "/out/chapters.txt", "/out/My Book.m4b")
+
+	want := []string{
+		"-y",
+		"-f", "concat", "-safe", "0", "-i", "/out/concat.txt",
+		"-i", "/out/chapters.txt", "-map_metadata", "1",
+		"-metadata", "title=My Book",
+		"-metadata", "album=My Book",
+		"-c:a", "aac", "/out/My Book.m4b",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestReplaceExt(t *testing.T) {
+	tests := []struct {
+		path   string
+		format string
+		want   string
+	}{
+		{"/out/part.mp3", "mp3", "/out/part.mp3"},
+		{"/out/part.mp3", "m4b", "/out/part.m4b"},
+		{"/out/part.flac", "opus", "/out/part.opus"},
+	}
+	for _, tt := range tests {
+		if got := replaceExt(tt.path, tt.format); got != tt.want {
+			t.Errorf("replaceExt(%q, %q) = %q, want %q", tt.path, tt.format, got, tt.want)
+		}
+	}
+}
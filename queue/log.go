@@ -0,0 +1,55 @@
+package queue
+
+import "sync"
+
+// logBroadcaster keeps a bounded backlog of log lines and fans them out to
+// any number of subscribers, so a late SSE client still sees history and a
+// slow one never blocks job processing.
+type logBroadcaster struct {
+	mu          sync.Mutex
+	history     []string
+	subscribers map[chan string]struct{}
+}
+
+const logHistoryLimit = 1000
+
+func newLogBroadcaster() *logBroadcaster {
+	return &logBroadcaster{subscribers: make(map[chan string]struct{})}
+}
+
+func (b *logBroadcaster) publish(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.history = append(b.history, line)
+	if len(b.history) > logHistoryLimit {
+		b.history = b.history[len(b.history)-logHistoryLimit:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- line:
+		default:
+			// Slow subscriber; drop the line rather than block the job.
+		}
+	}
+}
+
+func (b *logBroadcaster) subscribe() (<-chan string, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan string, logHistoryLimit)
+	for _, line := range b.history {
+		ch <- line
+	}
+	b.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	return ch, unsubscribe
+}
@@ -0,0 +1,243 @@
+// Package queue runs .odm downloads as background jobs with a bounded
+// worker pool, so a daemon can accept uploads and report progress instead
+// of blocking on a single CLI invocation.
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Status is a job's position in its processing pipeline.
+type Status string
+
+const (
+	StatusQueued      Status = "queued"
+	StatusLicensing   Status = "licensing"
+	StatusDownloading Status = "downloading"
+	StatusPostprocess Status = "postprocess"
+	StatusDone        Status = "done"
+	StatusError       Status = "error"
+	StatusCancelled   Status = "cancelled"
+)
+
+// Handler processes a single job. It should call job.SetStatus as it makes
+// progress and job.Logf to emit log lines, and should return promptly when
+// ctx is cancelled.
+type Handler func(ctx context.Context, job *Job) error
+
+// Job is one enqueued .odm file and its processing state.
+type Job struct {
+	ID   string
+	Path string
+	// Dest is the output directory (or config default, if empty) that the
+	// handler should write downloaded/processed files to.
+	Dest string
+
+	mu       sync.Mutex
+	status   Status
+	progress float64
+	err      error
+
+	cancel  context.CancelFunc
+	log     *logBroadcaster
+	cleanup func()
+}
+
+// Info is a point-in-time, JSON-friendly snapshot of a Job.
+type Info struct {
+	ID       string  `json:"id"`
+	Path     string  `json:"path"`
+	Dest     string  `json:"dest,omitempty"`
+	Status   Status  `json:"status"`
+	Progress float64 `json:"progress"`
+	Error    string  `json:"error,omitempty"`
+}
+
+func newJob(id, path, dest string) *Job {
+	return &Job{ID: id, Path: path, Dest: dest, status: StatusQueued, log: newLogBroadcaster()}
+}
+
+// SetStatus updates the job's pipeline stage.
+func (j *Job) SetStatus(status Status) {
+	j.mu.Lock()
+	j.status = status
+	j.mu.Unlock()
+	j.log.publish(fmt.Sprintf("status: %s", status))
+}
+
+// SetProgress updates the job's completion fraction, in [0, 1].
+func (j *Job) SetProgress(progress float64) {
+	j.mu.Lock()
+	j.progress = progress
+	j.mu.Unlock()
+}
+
+// Logf emits a log line, visible to subscribers of the job's log stream.
+func (j *Job) Logf(format string, args ...any) {
+	j.log.publish(fmt.Sprintf(format, args...))
+}
+
+// Info returns a snapshot of the job's current state.
+func (j *Job) Info() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := Info{ID: j.ID, Path: j.Path, Dest: j.Dest, Status: j.status, Progress: j.progress}
+	if j.err != nil {
+		info.Error = j.err.Error()
+	}
+	return info
+}
+
+// Subscribe returns a channel of past and future log lines for this job,
+// and a function to unsubscribe once the caller is done (e.g. an SSE
+// client disconnects).
+func (j *Job) Subscribe() (lines <-chan string, unsubscribe func()) {
+	return j.log.subscribe()
+}
+
+// Queue runs enqueued jobs through handler using a bounded pool of
+// workers.
+type Queue struct {
+	handler Handler
+	pending chan *Job
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	nextID  int
+	workers int
+}
+
+// New returns a Queue that runs up to workers jobs concurrently via
+// handler. Call Start to launch the worker pool.
+func New(workers int, handler Handler) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Queue{
+		handler: handler,
+		pending: make(chan *Job, 64),
+		jobs:    make(map[string]*Job),
+		workers: workers,
+	}
+}
+
+// Start launches the worker pool; it returns once ctx is cancelled and all
+// workers have exited.
+func (q *Queue) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.worker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job, ok := <-q.pending:
+			if !ok {
+				return
+			}
+			q.process(ctx, job)
+		}
+	}
+}
+
+func (q *Queue) process(ctx context.Context, job *Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	job.mu.Lock()
+	job.cancel = cancel
+	job.mu.Unlock()
+	defer cancel()
+	if job.cleanup != nil {
+		defer job.cleanup()
+	}
+
+	err := q.handler(jobCtx, job)
+
+	job.mu.Lock()
+	job.err = err
+	if err != nil {
+		if jobCtx.Err() != nil {
+			job.status = StatusCancelled
+		} else {
+			job.status = StatusError
+		}
+	} else {
+		job.status = StatusDone
+		job.progress = 1
+	}
+	job.mu.Unlock()
+}
+
+// Enqueue adds a new job for path and returns it. The job starts in
+// StatusQueued and will be picked up by a free worker, writing output to
+// the handler's default destination.
+func (q *Queue) Enqueue(path string) *Job {
+	return q.enqueue(path, "", nil)
+}
+
+// EnqueueWithDest adds a new job for path that writes its output to dest
+// (or the handler's default destination, if dest is empty). cleanup, if
+// non-nil, runs once the job finishes, whether it succeeds or fails; it is
+// typically used to remove a per-job staging directory.
+func (q *Queue) EnqueueWithDest(path, dest string, cleanup func()) *Job {
+	return q.enqueue(path, dest, cleanup)
+}
+
+func (q *Queue) enqueue(path, dest string, cleanup func()) *Job {
+	q.mu.Lock()
+	q.nextID++
+	id := fmt.Sprintf("job-%d", q.nextID)
+	job := newJob(id, path, dest)
+	job.cleanup = cleanup
+	q.jobs[id] = job
+	q.mu.Unlock()
+
+	q.pending <- job
+	return job
+}
+
+// Get returns the job with the given ID, if any.
+func (q *Queue) Get(id string) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	return job, ok
+}
+
+// List returns all known jobs, in no particular order.
+func (q *Queue) List() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// Cancel cancels the job with the given ID, if it is running. It returns
+// false if no such job exists.
+func (q *Queue) Cancel(id string) bool {
+	job, ok := q.Get(id)
+	if !ok {
+		return false
+	}
+	job.mu.Lock()
+	cancel := job.cancel
+	job.mu.Unlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	return true
+}
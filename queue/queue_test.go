@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitForTerminal(t *testing.T, job *Job) Info {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		info := job.Info()
+		switch info.Status {
+		case StatusDone, StatusError, StatusCancelled:
+			return info
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach a terminal status in time, last status %s", job.ID, job.Info().Status)
+	return Info{}
+}
+
+func TestQueueProcessSuccess(t *testing.T) {
+	q := New(1, func(ctx context.Context, job *Job) error {
+		job.SetStatus(StatusDownloading)
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	job := q.Enqueue("title.odm")
+	info := waitForTerminal(t, job)
+	if info.Status != StatusDone {
+		t.Errorf("status = %s, want %s", info.Status, StatusDone)
+	}
+	if info.Progress != 1 {
+		t.Errorf("progress = %v, want 1", info.Progress)
+	}
+	if info.Error != "" {
+		t.Errorf("error = %q, want empty", info.Error)
+	}
+}
+
+func TestQueueProcessError(t *testing.T) {
+	wantErr := errors.New("boom")
+	q := New(1, func(ctx context.Context, job *Job) error {
+		return wantErr
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	job := q.Enqueue("title.odm")
+	info := waitForTerminal(t, job)
+	if info.Status != StatusError {
+		t.Errorf("status = %s, want %s", info.Status, StatusError)
+	}
+	if info.Error != wantErr.Error() {
+		t.Errorf("error = %q, want %q", info.Error, wantErr.Error())
+	}
+}
+
+func TestQueueCancelRunningJob(t *testing.T) {
+	started := make(chan struct{})
+	q := New(1, func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	job := q.Enqueue("title.odm")
+	<-started
+	if ok := q.Cancel(job.ID); !ok {
+		t.Fatal("Cancel() = false, want true for a running job")
+	}
+
+	info := waitForTerminal(t, job)
+	if info.Status != StatusCancelled {
+		t.Errorf("status = %s, want %s", info.Status, StatusCancelled)
+	}
+}
+
+func TestQueueCancelUnknownJob(t *testing.T) {
+	q := New(1, func(ctx context.Context, job *Job) error { return nil })
+	if ok := q.Cancel("nope"); ok {
+		t.Error("Cancel(unknown id) = true, want false")
+	}
+}
+
+func TestQueueEnqueueWithDestCleanup(t *testing.T) {
+	cleaned := make(chan struct{})
+	q := New(1, func(ctx context.Context, job *Job) error {
+		if job.Dest != "out" {
+			t.Errorf("job.Dest = %q, want %q", job.Dest, "out")
+		}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Start(ctx)
+
+	job := q.EnqueueWithDest("staged.odm", "out", func() { close(cleaned) })
+	waitForTerminal(t, job)
+
+	select {
+	case <-cleaned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("cleanup was not called after job finished")
+	}
+}
+
+func TestQueueGetAndList(t *testing.T) {
+	q := New(1, func(ctx context.Context, job *Job) error { return nil })
+	job := q.Enqueue("title.odm")
+
+	got, ok := q.Get(job.ID)
+	if !ok || got != job {
+		t.Errorf("Get(%q) = (%v, %v), want (job, true)", job.ID, got, ok)
+	}
+
+	if _, ok := q.Get("nope"); ok {
+		t.Error("Get(unknown id) ok = true, want false")
+	}
+
+	list := q.List()
+	if len(list) != 1 || list[0] != job {
+		t.Errorf("List() = %v, want [job]", list)
+	}
+}
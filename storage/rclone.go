@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"time"
+)
+
+// rcloneStorage writes to an rclone remote (e.g. "s3:bucket/path") by
+// shelling out to the rclone binary, so it supports any backend rclone
+// does (S3, B2, WebDAV, SFTP, Google Drive, ...) without linking rclone's
+// (very large) library into odm.
+type rcloneStorage struct {
+	remote string
+}
+
+// NewRclone returns a Storage that writes into the given rclone remote,
+// e.g. "s3:my-bucket/audiobooks".
+func NewRclone(remote string) Storage {
+	return &rcloneStorage{remote: remote}
+}
+
+func (s *rcloneStorage) join(p string) string {
+	return path.Join(s.remote, p)
+}
+
+// Create streams written bytes directly to the remote via "rclone rcat",
+// without staging the file on local disk.
+func (s *rcloneStorage) Create(p string) (io.WriteCloser, error) {
+	cmd := exec.Command("rclone", "rcat", s.join(p))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &rcatWriter{stdin: stdin, cmd: cmd, stderr: &stderr}, nil
+}
+
+type rcatWriter struct {
+	stdin  io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (w *rcatWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+func (w *rcatWriter) Close() error {
+	if err := w.stdin.Close(); err != nil {
+		return err
+	}
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("rclone rcat: %w: %s", err, w.stderr.String())
+	}
+	return nil
+}
+
+// Open streams a remote object's bytes via "rclone cat".
+func (s *rcloneStorage) Open(p string) (io.ReadCloser, error) {
+	cmd := exec.Command("rclone", "cat", s.join(p))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &rcatReader{stdout: stdout, cmd: cmd, stderr: &stderr}, nil
+}
+
+type rcatReader struct {
+	stdout io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (r *rcatReader) Read(p []byte) (int, error) {
+	return r.stdout.Read(p)
+}
+
+func (r *rcatReader) Close() error {
+	r.stdout.Close()
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("rclone cat: %w: %s", err, r.stderr.String())
+	}
+	return nil
+}
+
+// OpenFile always fails: rclone remotes don't support the random-access
+// writes a chunked download needs. Callers fall back to Create.
+func (s *rcloneStorage) OpenFile(p string, _ os.FileMode) (RandomAccessFile, error) {
+	return nil, ErrRandomAccessUnsupported
+}
+
+func (s *rcloneStorage) Remove(p string) error {
+	cmd := exec.Command("rclone", "deletefile", s.join(p))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rclone deletefile: %w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func (s *rcloneStorage) MkdirAll(p string, _ os.FileMode) error {
+	cmd := exec.Command("rclone", "mkdir", s.join(p))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rclone mkdir: %w: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func (s *rcloneStorage) Exists(p string) (bool, error) {
+	info, err := s.Stat(p)
+	if err != nil {
+		return false, nil
+	}
+	return info != nil, nil
+}
+
+type rcloneFileInfo struct {
+	name    string
+	size    int64
+	isDir   bool
+	modTime time.Time
+}
+
+func (i *rcloneFileInfo) Name() string       { return i.name }
+func (i *rcloneFileInfo) Size() int64        { return i.size }
+func (i *rcloneFileInfo) Mode() os.FileMode  { return 0644 }
+func (i *rcloneFileInfo) ModTime() time.Time { return i.modTime }
+func (i *rcloneFileInfo) IsDir() bool        { return i.isDir }
+func (i *rcloneFileInfo) Sys() any           { return nil }
+
+// Stat shells out to "rclone lsjson" to describe a single remote object.
+func (s *rcloneStorage) Stat(p string) (os.FileInfo, error) {
+	cmd := exec.Command("rclone", "lsjson", s.join(p))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("rclone lsjson: %w: %s", err, stderr.String())
+	}
+
+	var entries []struct {
+		Name    string    `json:"Name"`
+		Size    int64     `json:"Size"`
+		IsDir   bool      `json:"IsDir"`
+		ModTime time.Time `json:"ModTime"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	entry := entries[0]
+	return &rcloneFileInfo{name: entry.Name, size: entry.Size, isDir: entry.IsDir, modTime: entry.ModTime}, nil
+}
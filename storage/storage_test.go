@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryCreateOpen(t *testing.T) {
+	store := NewMemory()
+
+	writer, err := store.Create("a/b/part.mp3")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := writer.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("writer.Close() error = %v", err)
+	}
+
+	reader, err := store.Open("a/b/part.mp3")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("read content = %q, want %q", got, "hello")
+	}
+}
+
+func TestMemoryExists(t *testing.T) {
+	store := NewMemory()
+
+	if exists, err := store.Exists("missing.mp3"); err != nil || exists {
+		t.Errorf("Exists() = (%v, %v), want (false, nil)", exists, err)
+	}
+
+	writer, err := store.Create("present.mp3")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	writer.Close()
+
+	if exists, err := store.Exists("present.mp3"); err != nil || !exists {
+		t.Errorf("Exists() = (%v, %v), want (true, nil)", exists, err)
+	}
+}
+
+func TestMemoryMkdirAllAndStat(t *testing.T) {
+	store := NewMemory()
+
+	if err := store.MkdirAll(filepath.Join("a", "b", "c"), 0777); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+
+	info, err := store.Stat(filepath.Join("a", "b", "c"))
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if !info.IsDir() {
+		t.Error("Stat() IsDir() = false, want true")
+	}
+}
+
+func TestMemoryRemove(t *testing.T) {
+	store := NewMemory()
+
+	writer, err := store.Create("part.mp3")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	writer.Close()
+
+	if err := store.Remove("part.mp3"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if exists, _ := store.Exists("part.mp3"); exists {
+		t.Error("file still exists after Remove()")
+	}
+}
+
+func TestMemoryOpenFile(t *testing.T) {
+	store := NewMemory()
+
+	file, err := store.OpenFile("part.mp3", 0666)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	defer file.Close()
+
+	if err := file.Truncate(5); err != nil {
+		t.Fatalf("Truncate() error = %v", err)
+	}
+	if _, err := file.WriteAt([]byte("hi"), 3); err != nil {
+		t.Fatalf("WriteAt() error = %v", err)
+	}
+	file.Close()
+
+	reader, err := store.Open("part.mp3")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	want := "\x00\x00\x00hi"
+	if string(got) != want {
+		t.Errorf("read content = %q, want %q", got, want)
+	}
+}